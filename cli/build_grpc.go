@@ -0,0 +1,190 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"time"
+
+	"github.com/uber/makisu/lib/authn"
+	"github.com/uber/makisu/lib/buildpb"
+	"github.com/uber/makisu/lib/jobstore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// grpcBuildServer implements buildpb.BuildServiceServer on top of the same
+// jobManager/jobstore.Store that back the /builds JSON/HTTP API, so a job
+// submitted over one transport is visible through the other.
+type grpcBuildServer struct {
+	jobs *jobManager
+}
+
+func (s *grpcBuildServer) Submit(ctx context.Context, req *buildpb.SubmitRequest) (*buildpb.SubmitResponse, error) {
+	id, err := s.jobs.submit(BuildRequest(req.Args))
+	if err != nil {
+		return nil, errInternal("submit job", err)
+	}
+	return &buildpb.SubmitResponse{Id: id}, nil
+}
+
+func (s *grpcBuildServer) Get(ctx context.Context, req *buildpb.GetRequest) (*buildpb.JobStatus, error) {
+	record, err := s.jobs.store.Load(req.Id)
+	if err != nil {
+		return nil, errInternal("load job", err)
+	} else if record == nil {
+		return nil, errNotFound(req.Id)
+	}
+	return toProtoStatus(record), nil
+}
+
+func (s *grpcBuildServer) Cancel(ctx context.Context, req *buildpb.CancelRequest) (*buildpb.CancelResponse, error) {
+	record, err := s.jobs.store.Load(req.Id)
+	if err != nil {
+		return nil, errInternal("load job", err)
+	} else if record == nil {
+		return nil, errNotFound(req.Id)
+	}
+	return &buildpb.CancelResponse{Canceled: s.jobs.cancel(req.Id)}, nil
+}
+
+func (s *grpcBuildServer) StreamLogs(req *buildpb.StreamLogsRequest, stream buildpb.BuildService_StreamLogsServer) error {
+	record, err := s.jobs.store.Load(req.Id)
+	if err != nil {
+		return errInternal("load job", err)
+	} else if record == nil {
+		return errNotFound(req.Id)
+	}
+
+	f, err := os.Open(s.jobs.store.LogPath(req.Id))
+	if err != nil {
+		return errInternal("open job log", err)
+	}
+	defer f.Close()
+
+	buf := make([]byte, 4096)
+	var pending []byte
+	for {
+		n, err := f.Read(buf)
+		if n > 0 {
+			pending = append(pending, buf[:n]...)
+			for {
+				idx := bytes.IndexByte(pending, '\n')
+				if idx < 0 {
+					break
+				}
+				line := string(pending[:idx])
+				level, msg := splitLogLevel(line)
+				entry := &buildpb.LogEntry{Line: line, Level: level, Msg: msg}
+				if sendErr := stream.Send(entry); sendErr != nil {
+					return sendErr
+				}
+				pending = pending[idx+1:]
+			}
+		}
+		if err == nil {
+			continue
+		}
+		if err != io.EOF {
+			return errInternal("read job log", err)
+		}
+		if !req.Follow {
+			return nil
+		}
+		current, loadErr := s.jobs.store.Load(req.Id)
+		if loadErr == nil && current != nil && current.Done() {
+			return nil
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+func toProtoStatus(r *jobstore.Record) *buildpb.JobStatus {
+	result := &buildpb.JobStatus{
+		Id:            r.ID,
+		Args:          r.Args,
+		Status:        string(r.Status),
+		Error:         r.Error,
+		CreatedAtUnix: r.CreatedAt.Unix(),
+	}
+	if r.StartedAt != nil {
+		result.StartedAtUnix = r.StartedAt.Unix()
+	}
+	if r.FinishedAt != nil {
+		result.FinishedAtUnix = r.FinishedAt.Unix()
+	}
+	return result
+}
+
+func errNotFound(id string) error {
+	return status.Errorf(codes.NotFound, "job not found: %s", id)
+}
+
+// errInternal wraps a job store/pipeline failure as a gRPC status error so
+// clients see codes.Internal instead of the unhelpful codes.Unknown a bare
+// error gets mapped to.
+func errInternal(what string, err error) error {
+	return status.Errorf(codes.Internal, "%s: %v", what, err)
+}
+
+// buildServiceScope maps a BuildService RPC to the scope required to call
+// it, mirroring the build:write/build:read split enforced on the
+// equivalent /build* HTTP routes.
+func buildServiceScope(fullMethod string) string {
+	switch fullMethod {
+	case "/build.BuildService/Submit", "/build.BuildService/Cancel":
+		return "build:write"
+	default:
+		return "build:read"
+	}
+}
+
+// authUnaryInterceptor enforces auth on Submit/Get/Cancel, the unary
+// BuildService RPCs, so that exposing the gRPC port over TCP (see
+// --listen-addr) is governed by the same --auth-mode as the HTTP API.
+func authUnaryInterceptor(auth authn.Authenticator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		scope := buildServiceScope(info.FullMethod)
+		id, err := auth.AuthenticateGRPC(ctx)
+		if err != nil {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+		if !id.HasScope(scope) {
+			return nil, status.Errorf(codes.PermissionDenied, "subject %q is missing scope %q", id.Subject, scope)
+		}
+		if auth.Audit != nil {
+			auth.Audit(id, scope, info.FullMethod)
+		}
+		return handler(authn.WithIdentity(ctx, id), req)
+	}
+}
+
+// authStreamInterceptor enforces auth on StreamLogs, the one streaming
+// BuildService RPC.
+func authStreamInterceptor(auth authn.Authenticator) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		scope := buildServiceScope(info.FullMethod)
+		id, err := auth.AuthenticateGRPC(ss.Context())
+		if err != nil {
+			return status.Error(codes.Unauthenticated, err.Error())
+		}
+		if !id.HasScope(scope) {
+			return status.Errorf(codes.PermissionDenied, "subject %q is missing scope %q", id.Subject, scope)
+		}
+		if auth.Audit != nil {
+			auth.Audit(id, scope, info.FullMethod)
+		}
+		return handler(srv, &authedServerStream{ServerStream: ss, ctx: authn.WithIdentity(ss.Context(), id)})
+	}
+}
+
+// authedServerStream overrides Context() so that handlers observe the
+// Identity authStreamInterceptor attached.
+type authedServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authedServerStream) Context() context.Context { return s.ctx }
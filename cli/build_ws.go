@@ -0,0 +1,207 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/uber/makisu/lib/docker/distribution"
+	"github.com/uber/makisu/lib/log"
+	"github.com/apourchet/commander"
+	"github.com/gorilla/websocket"
+)
+
+// wsUpgrader upgrades /build/ws connections. Origin checking is left to
+// whatever reverse proxy or auth middleware sits in front of `makisu
+// listen`, matching the rest of this package's handlers.
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+}
+
+// wsFrame is the envelope every frame exchanged over /build/ws is decoded
+// into; Type selects how the remaining fields are interpreted.
+type wsFrame struct {
+	Type string `json:"type"`
+
+	// Client -> server fields.
+	Args []string `json:"args,omitempty"`
+
+	// Server -> client fields. The int/int64 fields below omit omitempty:
+	// 0 is a meaningful value for all of them (success exit code, first
+	// step, a progress report that's only just started), and omitempty
+	// would silently drop the field from the wire rather than send it as
+	// 0, which a client reading "no step field" as "no step reported"
+	// would misinterpret as the field never having been sent at all.
+	Level       string `json:"level,omitempty"`
+	Phase       string `json:"phase,omitempty"`
+	Step        int    `json:"step"`
+	Msg         string `json:"msg,omitempty"`
+	Layer       string `json:"layer,omitempty"`
+	Bytes       int64  `json:"bytes"`
+	Total       int64  `json:"total"`
+	ExitCode    int    `json:"exitCode"`
+	ImageDigest string `json:"imageDigest,omitempty"`
+}
+
+// buildWS handles `/build/ws`: it upgrades to a WebSocket, waits for a
+// "start" frame, runs the build, and emits "log"/"progress" frames until a
+// terminal "done" frame is sent. A "cancel" frame does not interrupt the
+// build already in flight: the done frame, with exit code 1, is sent once
+// that build has finished.
+func (cmd ListenFlags) buildWS(rw http.ResponseWriter, req *http.Request) {
+	conn, err := wsUpgrader.Upgrade(rw, req, nil)
+	if err != nil {
+		log.Errorf("failed to upgrade /build/ws connection: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	var start wsFrame
+	if err := conn.ReadJSON(&start); err != nil {
+		log.Errorf("failed to read start frame: %v", err)
+		return
+	}
+	if start.Type != "start" {
+		conn.WriteJSON(wsFrame{Type: "done", ExitCode: 1})
+		return
+	}
+
+	// /build/ws must count against --max-parallel-builds the same as the
+	// async job queue and the legacy /build handler; otherwise the cap can
+	// be exceeded by driving builds over this transport instead.
+	if !cmd.jobs.tryAcquire() {
+		conn.WriteJSON(wsFrame{Type: "done", ExitCode: 1})
+		return
+	}
+	defer cmd.jobs.release()
+
+	ctx, cancel := context.WithCancel(req.Context())
+	defer cancel()
+
+	var writeMu sync.Mutex
+	send := func(frame wsFrame) {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		conn.WriteJSON(frame)
+	}
+
+	// The client may send "cancel" or "stdin" frames at any point while the
+	// build is running; read them on a dedicated goroutine since ReadJSON
+	// blocks. Stdin frames are accepted but not yet wired into the build
+	// pipeline, which has no interactive input today.
+	go func() {
+		for {
+			var frame wsFrame
+			if err := conn.ReadJSON(&frame); err != nil {
+				return
+			}
+			switch frame.Type {
+			case "cancel":
+				cancel()
+				return
+			case "stdin":
+				// No-op until the build pipeline accepts interactive input.
+			}
+		}
+	}()
+
+	exitCode := 0
+	digest, err := cmd.runBuildWS(ctx, start.Args, send)
+	if err != nil {
+		exitCode = 1
+		send(wsFrame{Type: "log", Level: "error", Msg: err.Error()})
+	}
+	send(wsFrame{Type: "done", ExitCode: exitCode, ImageDigest: digest})
+}
+
+// runBuildWS runs the build pipeline for args, translating every log line
+// it emits into a "log" frame via send and returning the digest of the
+// pushed image on success. It registers this build's progress/digest
+// callbacks with lib/docker/distribution so that package's Client.Push
+// surfaces its layer-upload progress as "progress" frames and its final
+// digest as the done frame's ImageDigest.
+func (cmd ListenFlags) runBuildWS(ctx context.Context, args BuildRequest, send func(wsFrame)) (string, error) {
+	stderrCaptureMu.Lock()
+	defer stderrCaptureMu.Unlock()
+
+	r, newStderr, err := os.Pipe()
+	if err != nil {
+		return "", err
+	}
+
+	oldLogger := log.GetLogger()
+	os.Stderr = newStderr
+	done := make(chan bool, 0)
+	go func() {
+		defer func() { done <- true }()
+		reader := bufio.NewReader(r)
+		for {
+			line, _, err := reader.ReadLine()
+			if err != nil {
+				return
+			}
+			level, msg := splitLogLevel(string(line))
+			send(wsFrame{Type: "log", Level: level, Msg: msg})
+		}
+	}()
+	defer func() {
+		newStderr.Close()
+		<-done
+		log.SetLogger(oldLogger)
+	}()
+
+	var digest string
+	distribution.SetHooks(
+		func(layer string, bytes, total int64) {
+			send(wsFrame{Type: "progress", Layer: layer, Bytes: bytes, Total: total})
+		},
+		func(d string) { digest = d },
+	)
+	defer distribution.SetHooks(nil, nil)
+
+	app, err := NewApplication()
+	if err != nil {
+		return "", err
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		c := commander.New()
+		c.FlagErrorHandling = flag.ContinueOnError
+		if err := c.RunCLI(app, args); err != nil {
+			result <- err
+			return
+		}
+		result <- app.Cleanup()
+	}()
+
+	select {
+	case <-ctx.Done():
+		// The build pipeline doesn't yet accept a context, so canceling
+		// can't preempt the commander.RunCLI call already in flight. Wait
+		// for it to actually finish (including any image push) before
+		// returning, so the caller's semaphore slot stays reserved until
+		// the build it names has really stopped.
+		<-result
+		return digest, ctx.Err()
+	case err := <-result:
+		return digest, err
+	}
+}
+
+// splitLogLevel best-effort extracts the zap level prefix (e.g. "INFO",
+// "ERROR") that lib/log lines start with so /build/ws frames preserve it;
+// lines that don't match are reported at "info".
+func splitLogLevel(line string) (level, msg string) {
+	for _, candidate := range []string{"DEBUG", "INFO", "WARN", "ERROR", "FATAL"} {
+		if strings.HasPrefix(line, candidate) {
+			return strings.ToLower(candidate), strings.TrimSpace(strings.TrimPrefix(line, candidate))
+		}
+	}
+	return "info", line
+}
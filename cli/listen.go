@@ -2,31 +2,65 @@ package cli
 
 import (
 	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"mime"
 	"net"
 	"net/http"
 	"os"
 	"path"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/uber/makisu/lib/authn"
+	"github.com/uber/makisu/lib/buildpb"
+	"github.com/uber/makisu/lib/contextunpack"
+	"github.com/uber/makisu/lib/jobstore"
 	"github.com/uber/makisu/lib/log"
 	"github.com/apourchet/commander"
-	"go.uber.org/atomic"
+	"github.com/oklog/ulid/v2"
+	"github.com/soheilhy/cmux"
+	"google.golang.org/grpc"
 )
 
 // ListenFlags contains all of the flags for `makisu listen ...`
 type ListenFlags struct {
-	SocketPath string `commander:"flag=s,The absolute path of the unix socket that makisu will listen on"`
-	building   *atomic.Bool
+	SocketPath        string `commander:"flag=s,The absolute path of the unix socket that makisu will listen on"`
+	JobDir            string `commander:"flag=job-dir,The directory that persisted build job state is written to"`
+	MaxJobs           int    `commander:"flag=max-jobs,The maximum number of build jobs to retain on disk; only completed jobs are evicted"`
+	MaxParallelBuilds int    `commander:"flag=max-parallel-builds,The maximum number of builds that may run at the same time"`
+
+	ListenAddr  string `commander:"flag=listen-addr,The TCP address (e.g. :2375) that makisu will additionally listen on"`
+	TLSCert     string `commander:"flag=tls-cert,Path to the TLS certificate used for the TCP listener"`
+	TLSKey      string `commander:"flag=tls-key,Path to the TLS private key used for the TCP listener"`
+	TLSClientCA string `commander:"flag=tls-client-ca,Path to a CA bundle; when set, the TCP listener requires and verifies client certificates"`
+
+	MaxContextSize int64 `commander:"flag=max-context-size,Maximum size in bytes of a build context uploaded via multipart/form-data"`
+
+	AuthMode       string `commander:"flag=auth-mode,One of none, token, or mtls; controls how /build* requests are authenticated"`
+	AuthTokensFile string `commander:"flag=auth-tokens-file,Path to a JSON file of {token: {subject, scopes}}, required when auth-mode=token"`
+
+	jobs *jobManager
 }
 
+// defaultMaxContextSize bounds a multipart-uploaded build context when
+// MaxContextSize isn't set.
+const defaultMaxContextSize = 1 << 30 // 1GiB
+
 func newListenFlags() ListenFlags {
 	return ListenFlags{
-		SocketPath: "/makisu-socket/makisu.sock",
-		building:   atomic.NewBool(false),
+		SocketPath:        "/makisu-socket/makisu.sock",
+		JobDir:            "/var/lib/makisu/jobs",
+		MaxJobs:           100,
+		MaxParallelBuilds: 1,
+		AuthMode:          string(authn.ModeNone),
 	}
 }
 
@@ -35,47 +69,431 @@ func newListenFlags() ListenFlags {
 //    ["build", "-t", "myimage:latest", "/context"]
 type BuildRequest []string
 
+// jobManager owns the on-disk job store, the queue of pending builds, and
+// the bookkeeping needed to cancel a running build by its job ID.
+type jobManager struct {
+	store *jobstore.Store
+	sem   chan struct{}
+
+	mu      chan struct{} // binary mutex guarding cancels, used instead of sync.Mutex to keep zero-value friendly construction out of this file
+	cancels map[string]context.CancelFunc
+}
+
+func newJobManager(store *jobstore.Store, maxParallel int) *jobManager {
+	if maxParallel <= 0 {
+		maxParallel = 1
+	}
+	m := &jobManager{
+		store:   store,
+		sem:     make(chan struct{}, maxParallel),
+		mu:      make(chan struct{}, 1),
+		cancels: make(map[string]context.CancelFunc),
+	}
+	m.mu <- struct{}{}
+	return m
+}
+
+func (m *jobManager) lock()   { <-m.mu }
+func (m *jobManager) unlock() { m.mu <- struct{}{} }
+
+func (m *jobManager) setCancel(id string, cancel context.CancelFunc) {
+	m.lock()
+	defer m.unlock()
+	m.cancels[id] = cancel
+}
+
+func (m *jobManager) clearCancel(id string) {
+	m.lock()
+	defer m.unlock()
+	delete(m.cancels, id)
+}
+
+func (m *jobManager) cancel(id string) bool {
+	m.lock()
+	cancel, ok := m.cancels[id]
+	m.unlock()
+	if !ok {
+		return false
+	}
+	cancel()
+	return true
+}
+
+// running reports how many build slots are currently occupied.
+func (m *jobManager) running() int { return len(m.sem) }
+
+// acquire blocks until a build slot is free. Every path that actually runs
+// a build (async jobs, the legacy /build handler, /build/ws) must go
+// through acquire, tryAcquire or acquireOrCancel so --max-parallel-builds is a real cap across
+// the whole API surface rather than just the async job queue.
+func (m *jobManager) acquire() { m.sem <- struct{}{} }
+
+// tryAcquire reserves a build slot without blocking, returning false if
+// none is free.
+func (m *jobManager) tryAcquire() bool {
+	select {
+	case m.sem <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// release frees a build slot reserved by acquire or tryAcquire.
+func (m *jobManager) release() { <-m.sem }
+
+// acquireOrCancel blocks until a build slot is free or ctx is canceled,
+// whichever comes first, reporting which happened. It lets a queued job
+// wait on the same semaphore acquire blocks on without becoming
+// uncancelable for however long it sits in the queue.
+func (m *jobManager) acquireOrCancel(ctx context.Context) bool {
+	select {
+	case m.sem <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// submit creates a job record and starts it asynchronously once a build
+// slot is available, returning immediately with the new job ID. The job's
+// cancel func is registered before run ever blocks on a build slot, so a
+// job that is still queued is just as cancelable via jobManager.cancel as
+// one that's already running.
+func (m *jobManager) submit(args BuildRequest) (string, error) {
+	id := ulid.Make().String()
+	if _, err := m.store.Create(id, args); err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.setCancel(id, cancel)
+	go m.run(id, ctx, args)
+	return id, nil
+}
+
+func (m *jobManager) run(id string, ctx context.Context, args BuildRequest) {
+	defer m.clearCancel(id)
+
+	if !m.acquireOrCancel(ctx) {
+		m.markCanceled(id)
+		return
+	}
+	defer m.release()
+
+	record, err := m.store.Load(id)
+	if err != nil || record == nil {
+		log.Errorf("failed to load job %s before starting: %v", id, err)
+		return
+	}
+	now := time.Now()
+	record.Status = jobstore.StatusRunning
+	record.StartedAt = &now
+	if err := m.store.Save(record); err != nil {
+		log.Errorf("failed to save job %s: %v", id, err)
+	}
+
+	logFile, err := os.OpenFile(m.store.LogPath(id), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		log.Errorf("failed to open log for job %s: %v", id, err)
+		return
+	}
+	defer logFile.Close()
+
+	runErr := runBuildPipeline(ctx, args, logFile)
+
+	finished := time.Now()
+	record.FinishedAt = &finished
+	switch {
+	case ctx.Err() == context.Canceled:
+		record.Status = jobstore.StatusCanceled
+	case runErr != nil:
+		record.Status = jobstore.StatusFailed
+		record.Error = runErr.Error()
+	default:
+		record.Status = jobstore.StatusSucceeded
+	}
+	if err := m.store.Save(record); err != nil {
+		log.Errorf("failed to save final state for job %s: %v", id, err)
+	}
+}
+
+// markCanceled persists a canceled status for a job that was aborted
+// before it ever acquired a build slot, so a DELETE /builds/{id} issued
+// against a still-queued job leaves behind the same terminal record a
+// cancellation mid-build would.
+func (m *jobManager) markCanceled(id string) {
+	record, err := m.store.Load(id)
+	if err != nil || record == nil {
+		log.Errorf("failed to load job %s to mark canceled: %v", id, err)
+		return
+	}
+	now := time.Now()
+	record.Status = jobstore.StatusCanceled
+	record.FinishedAt = &now
+	if err := m.store.Save(record); err != nil {
+		log.Errorf("failed to save canceled job %s: %v", id, err)
+	}
+}
+
+// stderrCaptureMu serializes every build pipeline invocation that redirects
+// the process-wide os.Stderr to capture CLI log output. The CLI logger is
+// process-global and keeps writing to os.Stderr for as long as the build
+// runs, so this mutex is held for the whole of runBuildPipeline/runBuildWS,
+// not just the brief setup/teardown around the redirect: as written,
+// --max-parallel-builds only bounds how many builds may hold a slot at
+// once (via jobManager.sem), not how many run their
+// compute concurrently. Making builds' compute actually overlap would mean
+// giving each build its own log sink instead of swapping a process-wide
+// os.Stderr, which lib/log doesn't support today.
+var stderrCaptureMu sync.Mutex
+
+// runBuildPipeline redirects the process-wide stderr pipe used by the
+// existing CLI logger into w for the duration of the build. Canceling ctx
+// does not interrupt a build already in flight: runBuildPipeline waits for
+// it to finish and then returns ctx.Err().
+func runBuildPipeline(ctx context.Context, args BuildRequest, w io.Writer) error {
+	stderrCaptureMu.Lock()
+	defer stderrCaptureMu.Unlock()
+
+	r, newStderr, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("failed to create log pipe: %v", err)
+	}
+
+	oldLogger := log.GetLogger()
+	os.Stderr = newStderr
+	done := make(chan bool, 0)
+	go func() {
+		defer func() { done <- true }()
+		reader := bufio.NewReader(r)
+		for {
+			line, _, err := reader.ReadLine()
+			if err != nil {
+				return
+			}
+			line = append(line, '\n')
+			w.Write(line)
+		}
+	}()
+	defer func() {
+		newStderr.Close()
+		<-done
+		log.SetLogger(oldLogger)
+	}()
+
+	app, err := NewApplication()
+	if err != nil {
+		return err
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		cmd := commander.New()
+		cmd.FlagErrorHandling = flag.ContinueOnError
+		if err := cmd.RunCLI(app, args); err != nil {
+			result <- err
+			return
+		}
+		result <- app.Cleanup()
+	}()
+
+	select {
+	case <-ctx.Done():
+		// The build pipeline doesn't yet accept a context, so a cancellation
+		// request can't preempt the commander.RunCLI call already in flight.
+		// Wait for it to actually finish (including any image push) before
+		// returning, so the caller's semaphore slot stays reserved and the
+		// job isn't reported canceled until the build it names has really
+		// stopped; returning early here would let it keep running off the
+		// books while --max-parallel-builds thinks the slot is free.
+		<-result
+		return ctx.Err()
+	case err := <-result:
+		return err
+	}
+}
+
 // Listen creates the directory structures and the makisu socket, then it
 // starts accepting http requests on that socket.
 func (cmd ListenFlags) Listen() error {
+	store, err := jobstore.New(cmd.JobDir, cmd.MaxJobs)
+	if err != nil {
+		return fmt.Errorf("failed to create job store: %v", err)
+	}
+	cmd.jobs = newJobManager(store, cmd.MaxParallelBuilds)
+
+	auth, err := cmd.authenticator()
+	if err != nil {
+		return fmt.Errorf("failed to configure auth: %v", err)
+	}
+
 	mux := http.NewServeMux()
-	mux.HandleFunc("/ready", cmd.ready)
-	mux.HandleFunc("/build", cmd.build)
+	mux.HandleFunc("/ready", auth.Middleware("health:read", cmd.ready))
+	mux.HandleFunc("/build", auth.Middleware("build:write", cmd.build))
+	mux.HandleFunc("/build/ws", auth.Middleware("build:write", cmd.buildWS))
+	mux.HandleFunc("/builds", auth.Middleware("build:write", cmd.createJob))
+	mux.HandleFunc("/builds/", auth.Middleware("build:read", cmd.jobByID))
 
 	if err := os.MkdirAll(path.Dir(cmd.SocketPath), os.ModePerm); err != nil {
 		return fmt.Errorf("failed to create directory to socket %s: %v", cmd.SocketPath, err)
 	}
 
-	lis, err := net.Listen("unix", cmd.SocketPath)
+	unixLis, err := net.Listen("unix", cmd.SocketPath)
 	if err != nil {
 		return fmt.Errorf("failed to listen on unix socket %s: %v", cmd.SocketPath, err)
 	}
 	log.Infof("Listening for build requests on unix socket %s", cmd.SocketPath)
 
-	server := http.Server{Handler: mux}
-	if err := server.Serve(lis); err != nil {
-		return fmt.Errorf("failed to serve on unix socket: %v", err)
+	handler := http.Handler(mux)
+	grpcServer := grpc.NewServer(
+		grpc.UnaryInterceptor(authUnaryInterceptor(auth)),
+		grpc.StreamInterceptor(authStreamInterceptor(auth)),
+	)
+	buildpb.RegisterBuildServiceServer(grpcServer, &grpcBuildServer{jobs: cmd.jobs})
+
+	errc := make(chan error, 2)
+	go func() { errc <- serveMuxed(unixLis, handler, grpcServer) }()
+
+	if cmd.ListenAddr != "" {
+		tcpLis, err := net.Listen("tcp", cmd.ListenAddr)
+		if err != nil {
+			return fmt.Errorf("failed to listen on %s: %v", cmd.ListenAddr, err)
+		}
+
+		if cmd.TLSCert != "" {
+			tlsConfig, err := cmd.tlsConfig()
+			if err != nil {
+				return fmt.Errorf("failed to configure TLS: %v", err)
+			}
+			tcpLis = tls.NewListener(tcpLis, tlsConfig)
+			log.Infof("Listening for build requests on %s (mTLS=%v)", cmd.ListenAddr, cmd.TLSClientCA != "")
+		} else {
+			log.Infof("Listening for build requests on %s", cmd.ListenAddr)
+		}
+
+		go func() { errc <- serveMuxed(tcpLis, withClientCN(handler), grpcServer) }()
+	}
+
+	if err := <-errc; err != nil {
+		return fmt.Errorf("failed to serve: %v", err)
 	}
 	return nil
 }
 
+// serveMuxed splits lis into a gRPC sub-listener and an HTTP sub-listener
+// using cmux, so that the BuildService gRPC API and the /build* JSON/HTTP
+// API can be reached over the exact same socket or TCP address.
+func serveMuxed(lis net.Listener, handler http.Handler, grpcServer *grpc.Server) error {
+	m := cmux.New(lis)
+	grpcLis := m.Match(cmux.HTTP2HeaderField("content-type", "application/grpc"))
+	httpLis := m.Match(cmux.Any())
+
+	errc := make(chan error, 3)
+	go func() { errc <- grpcServer.Serve(grpcLis) }()
+	go func() { errc <- (&http.Server{Handler: handler}).Serve(httpLis) }()
+	go func() { errc <- m.Serve() }()
+	return <-errc
+}
+
+// tlsConfig builds the *tls.Config used by the TCP listener from
+// cmd.TLSCert, cmd.TLSKey, and, when set, cmd.TLSClientCA.
+func (cmd ListenFlags) tlsConfig() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(cmd.TLSCert, cmd.TLSKey)
+	if err != nil {
+		return nil, fmt.Errorf("load TLS key pair: %v", err)
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{cert}}
+
+	if cmd.TLSClientCA != "" {
+		caBody, err := ioutil.ReadFile(cmd.TLSClientCA)
+		if err != nil {
+			return nil, fmt.Errorf("read client CA bundle %s: %v", cmd.TLSClientCA, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caBody) {
+			return nil, fmt.Errorf("no certificates found in client CA bundle %s", cmd.TLSClientCA)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+type clientCNKey struct{}
+
+// withClientCN wraps next so that handlers can recover the verified client
+// certificate's common name via ClientCNFromContext. It is a no-op when the
+// connection did not present a verified client certificate, which is always
+// the case on the unix socket listener.
+func withClientCN(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.TLS != nil && len(req.TLS.PeerCertificates) > 0 {
+			cn := req.TLS.PeerCertificates[0].Subject.CommonName
+			req = req.WithContext(context.WithValue(req.Context(), clientCNKey{}, cn))
+		}
+		next.ServeHTTP(rw, req)
+	})
+}
+
+// ClientCNFromContext returns the common name of the verified client
+// certificate for the request that produced ctx, if any.
+func ClientCNFromContext(ctx context.Context) (string, bool) {
+	cn, ok := ctx.Value(clientCNKey{}).(string)
+	return cn, ok
+}
+
+// authenticator builds the authn.Authenticator that every /build* route is
+// wrapped with, per cmd.AuthMode.
+func (cmd ListenFlags) authenticator() (authn.Authenticator, error) {
+	auth := authn.Authenticator{
+		Mode:     authn.Mode(cmd.AuthMode),
+		ClientCN: func(req *http.Request) (string, bool) { return ClientCNFromContext(req.Context()) },
+		Audit: func(id authn.Identity, scope, action string) {
+			log.Infof("audit: subject=%s scope=%s action=%s", id.Subject, scope, action)
+		},
+	}
+	if auth.Mode == authn.ModeToken {
+		if cmd.AuthTokensFile == "" {
+			return auth, fmt.Errorf("auth-mode=token requires --auth-tokens-file")
+		}
+		tokens, err := authn.LoadTokens(cmd.AuthTokensFile)
+		if err != nil {
+			return auth, err
+		}
+		auth.Tokens = tokens
+	}
+	return auth, nil
+}
+
 func (cmd ListenFlags) ready(rw http.ResponseWriter, req *http.Request) {
-	if cmd.building.Load() {
-		rw.WriteHeader(http.StatusConflict)
+	records, err := cmd.jobs.store.List()
+	if err != nil {
+		rw.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(rw, "%s\n", err.Error())
 		return
 	}
-	rw.WriteHeader(http.StatusOK)
+	queued := 0
+	for _, r := range records {
+		if r.Status == jobstore.StatusQueued {
+			queued++
+		}
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(struct {
+		QueueDepth int `json:"queueDepth"`
+		Running    int `json:"running"`
+	}{QueueDepth: queued, Running: cmd.jobs.running()})
 }
 
-func (cmd ListenFlags) build(rw http.ResponseWriter, req *http.Request) {
-	if ok := cmd.building.CAS(false, true); !ok {
-		rw.WriteHeader(http.StatusConflict)
-		rw.Write([]byte("Already processing a request"))
+// createJob handles `POST /builds`: it enqueues a new build job and
+// returns 202 Accepted with the generated job ID.
+func (cmd ListenFlags) createJob(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		rw.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
-	defer cmd.building.Store(false)
 
-	log.Infof("Serving build request")
 	args := &BuildRequest{}
 	body, err := ioutil.ReadAll(req.Body)
 	if err != nil {
@@ -88,57 +506,251 @@ func (cmd ListenFlags) build(rw http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	r, newStderr, err := os.Pipe()
+	id, err := cmd.jobs.submit(*args)
 	if err != nil {
 		rw.WriteHeader(http.StatusInternalServerError)
 		fmt.Fprintf(rw, "%s\n", err.Error())
 		return
 	}
+	if caller, ok := authn.FromContext(req.Context()); ok {
+		log.Infof("job %s submitted by subject=%s", id, caller.Subject)
+	}
 
-	log.Infof("Piping stdout to response")
-	oldLogger := log.GetLogger()
-	os.Stderr = newStderr
-	done := make(chan bool, 0)
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(rw).Encode(struct {
+		ID string `json:"id"`
+	}{ID: id})
+}
 
-	defer func() {
-		newStderr.Close()
-		<-done
-		log.SetLogger(oldLogger)
-		log.Infof("Build request served")
-	}()
+// jobByID dispatches `/builds/{id}`, `/builds/{id}/logs` and the DELETE
+// cancellation path based on the request method and trailing path segment.
+func (cmd ListenFlags) jobByID(rw http.ResponseWriter, req *http.Request) {
+	rest := strings.TrimPrefix(req.URL.Path, "/builds/")
+	id, sub := rest, ""
+	if idx := strings.IndexByte(rest, '/'); idx >= 0 {
+		id, sub = rest[:idx], rest[idx+1:]
+	}
+	if id == "" {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	}
 
-	go func() {
-		defer func() { done <- true }()
-		reader := bufio.NewReader(r)
-		for {
-			line, _, err := reader.ReadLine()
-			if err == io.EOF {
-				return
-			} else if err != nil {
-				return
-			}
-			line = append(line, '\n')
+	switch {
+	case sub == "logs":
+		cmd.jobLogs(rw, req, id)
+	case sub == "" && req.Method == http.MethodDelete:
+		cmd.cancelJob(rw, req, id)
+	case sub == "" && req.Method == http.MethodGet:
+		cmd.jobStatus(rw, id)
+	default:
+		rw.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (cmd ListenFlags) jobStatus(rw http.ResponseWriter, id string) {
+	record, err := cmd.jobs.store.Load(id)
+	if err != nil {
+		rw.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(rw, "%s\n", err.Error())
+		return
+	} else if record == nil {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(record)
+}
+
+func (cmd ListenFlags) cancelJob(rw http.ResponseWriter, req *http.Request, id string) {
+	if caller, ok := authn.FromContext(req.Context()); ok && !caller.HasScope("build:write") {
+		rw.WriteHeader(http.StatusForbidden)
+		fmt.Fprintf(rw, "subject %q is missing scope %q\n", caller.Subject, "build:write")
+		return
+	}
+
+	record, err := cmd.jobs.store.Load(id)
+	if err != nil {
+		rw.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(rw, "%s\n", err.Error())
+		return
+	} else if record == nil {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if !cmd.jobs.cancel(id) {
+		rw.WriteHeader(http.StatusConflict)
+		fmt.Fprintf(rw, "job %s is not running\n", id)
+		return
+	}
+	rw.WriteHeader(http.StatusAccepted)
+}
+
+// jobLogs handles `GET /builds/{id}/logs`, optionally following the log
+// file as new lines are appended until the job reaches a terminal state.
+func (cmd ListenFlags) jobLogs(rw http.ResponseWriter, req *http.Request, id string) {
+	record, err := cmd.jobs.store.Load(id)
+	if err != nil {
+		rw.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(rw, "%s\n", err.Error())
+		return
+	} else if record == nil {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	f, err := os.Open(cmd.jobs.store.LogPath(id))
+	if err != nil {
+		rw.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(rw, "%s\n", err.Error())
+		return
+	}
+	defer f.Close()
+
+	flusher, _ := rw.(http.Flusher)
+	follow := req.URL.Query().Get("follow") == "true"
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
 			rw.Write(line)
-			if f, ok := rw.(http.Flusher); ok {
-				f.Flush()
+			if flusher != nil {
+				flusher.Flush()
 			}
 		}
-	}()
-
-	rw.WriteHeader(http.StatusOK)
-	log.Infof("Starting build")
+		if err == nil {
+			continue
+		}
+		if err != io.EOF {
+			return
+		}
+		if !follow {
+			return
+		}
+		current, loadErr := cmd.jobs.store.Load(id)
+		if loadErr == nil && current != nil && current.Done() {
+			return
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
 
-	commander := commander.New()
-	commander.FlagErrorHandling = flag.ContinueOnError
-	app, err := NewApplication()
+func (cmd ListenFlags) build(rw http.ResponseWriter, req *http.Request) {
+	if caller, ok := authn.FromContext(req.Context()); ok {
+		log.Infof("Serving build request for subject=%s", caller.Subject)
+	} else {
+		log.Infof("Serving build request")
+	}
+	args, cleanup, err := cmd.parseBuildRequest(req)
 	if err != nil {
-		log.Errorf("%v", err)
+		rw.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(rw, "%s\n", err.Error())
 		return
-	} else if err := commander.RunCLI(app, *args); err != nil {
-		log.Errorf("%v", err)
+	}
+	defer cleanup()
+
+	if !cmd.jobs.tryAcquire() {
+		rw.WriteHeader(http.StatusConflict)
+		rw.Write([]byte("Already processing a request"))
 		return
-	} else if err := app.Cleanup(); err != nil {
+	}
+	defer cmd.jobs.release()
+
+	rw.WriteHeader(http.StatusOK)
+	rw.(http.Flusher).Flush()
+
+	w := &flushWriter{rw: rw}
+	if err := runBuildPipeline(context.Background(), args, w); err != nil {
 		log.Errorf("%v", err)
-		return
 	}
-}
\ No newline at end of file
+}
+
+// parseBuildRequest reads a BuildRequest from req, supporting both the
+// plain `application/json` body (args only, context path must already
+// exist on this host) and a `multipart/form-data` body with an "args" part
+// and a "context" part holding a tar or tar.gz stream of the build
+// context. In the multipart case, the context is unpacked into a tempdir
+// and substituted in place of the last element of args, and the returned
+// cleanup func removes that tempdir once the caller is done with it.
+func (cmd ListenFlags) parseBuildRequest(req *http.Request) (BuildRequest, func(), error) {
+	noop := func() {}
+
+	mediaType, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
+		args := &BuildRequest{}
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return nil, noop, err
+		} else if err := json.Unmarshal(body, args); err != nil {
+			return nil, noop, err
+		}
+		return *args, noop, nil
+	}
+
+	reader, err := req.MultipartReader()
+	if err != nil {
+		return nil, noop, fmt.Errorf("open multipart reader: %v", err)
+	}
+
+	var args *BuildRequest
+	var contextDir string
+	cleanup := noop
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, cleanup, fmt.Errorf("read multipart part: %v", err)
+		}
+
+		switch part.FormName() {
+		case "args":
+			body, err := ioutil.ReadAll(part)
+			if err != nil {
+				return nil, cleanup, fmt.Errorf("read args part: %v", err)
+			}
+			args = &BuildRequest{}
+			if err := json.Unmarshal(body, args); err != nil {
+				return nil, cleanup, fmt.Errorf("unmarshal args part: %v", err)
+			}
+		case "context":
+			contextDir, err = ioutil.TempDir("", "makisu-context-")
+			if err != nil {
+				return nil, cleanup, fmt.Errorf("create context tempdir: %v", err)
+			}
+			cleanup = func() { os.RemoveAll(contextDir) }
+			maxSize := cmd.MaxContextSize
+			if maxSize <= 0 {
+				maxSize = defaultMaxContextSize
+			}
+			if err := contextunpack.Unpack(part, contextDir, maxSize); err != nil {
+				return nil, cleanup, fmt.Errorf("unpack context: %v", err)
+			}
+		}
+	}
+
+	if args == nil {
+		return nil, cleanup, fmt.Errorf("multipart request is missing the %q part", "args")
+	}
+	if contextDir != "" {
+		if len(*args) == 0 {
+			return nil, cleanup, fmt.Errorf("args must include a context path to substitute")
+		}
+		(*args)[len(*args)-1] = contextDir
+	}
+	return *args, cleanup, nil
+}
+
+// flushWriter flushes the underlying ResponseWriter after every write so
+// that build output streams to the client as it is produced.
+type flushWriter struct {
+	rw http.ResponseWriter
+}
+
+func (w *flushWriter) Write(p []byte) (int, error) {
+	n, err := w.rw.Write(p)
+	if f, ok := w.rw.(http.Flusher); ok {
+		f.Flush()
+	}
+	return n, err
+}
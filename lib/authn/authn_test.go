@@ -0,0 +1,56 @@
+package authn
+
+import "testing"
+
+func TestIdentityHasScope(t *testing.T) {
+	tests := []struct {
+		name   string
+		scopes []string
+		scope  string
+		want   bool
+	}{
+		{name: "exact match", scopes: []string{"build:read", "build:write"}, scope: "build:write", want: true},
+		{name: "no match", scopes: []string{"build:read"}, scope: "build:write", want: false},
+		{name: "wildcard grants anything", scopes: []string{"*"}, scope: "build:write", want: true},
+		{name: "empty scopes grant nothing", scopes: nil, scope: "build:read", want: false},
+		{name: "unrelated wildcard-like string isn't the wildcard", scopes: []string{"build:*"}, scope: "build:write", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id := Identity{Subject: "test", Scopes: tt.scopes}
+			if got := id.HasScope(tt.scope); got != tt.want {
+				t.Errorf("HasScope(%q) with scopes %v = %v, want %v", tt.scope, tt.scopes, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthenticatorTokenIdentity(t *testing.T) {
+	a := Authenticator{
+		Mode: ModeToken,
+		Tokens: map[string]TokenEntry{
+			"good-token": {Subject: "alice", Scopes: []string{"build:read"}},
+		},
+	}
+
+	id, err := a.tokenIdentity("good-token")
+	if err != nil {
+		t.Fatalf("tokenIdentity(known token) returned error: %v", err)
+	}
+	if id.Subject != "alice" || !id.HasScope("build:read") {
+		t.Fatalf("tokenIdentity(known token) = %+v, want subject alice with scope build:read", id)
+	}
+
+	if _, err := a.tokenIdentity("unknown-token"); err == nil {
+		t.Fatal("tokenIdentity(unknown token) succeeded, want error (fail closed)")
+	}
+}
+
+func TestAnonymousAndMTLSIdentitiesHaveEveryScope(t *testing.T) {
+	if !anonymousIdentity().HasScope("anything:at-all") {
+		t.Error("anonymousIdentity() is not granted an arbitrary scope, want ModeNone to bypass scope checks entirely")
+	}
+	if !mtlsIdentity("some-cn").HasScope("anything:at-all") {
+		t.Error("mtlsIdentity() is not granted an arbitrary scope, want a verified client cert to be the only check")
+	}
+}
@@ -0,0 +1,352 @@
+// Package buildpb holds the Go stubs for the BuildService RPC defined in
+// proto/build.proto. It is maintained by hand in lockstep with that file
+// rather than by protoc, since this repo doesn't yet wire a protoc build
+// step; keep the two in sync when either changes.
+//
+// To regenerate once protoc and the go/go-grpc plugins are wired in:
+//
+//	protoc -I proto --go_out=. --go-grpc_out=. proto/build.proto
+package buildpb
+
+import (
+	"context"
+	"fmt"
+
+	proto "github.com/golang/protobuf/proto"
+	grpc "google.golang.org/grpc"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+
+type SubmitRequest struct {
+	Args []string `protobuf:"bytes,1,rep,name=args" json:"args,omitempty"`
+}
+
+func (m *SubmitRequest) Reset()         { *m = SubmitRequest{} }
+func (m *SubmitRequest) String() string { return proto.CompactTextString(m) }
+func (*SubmitRequest) ProtoMessage()    {}
+
+func (m *SubmitRequest) GetArgs() []string {
+	if m != nil {
+		return m.Args
+	}
+	return nil
+}
+
+type SubmitResponse struct {
+	Id string `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+}
+
+func (m *SubmitResponse) Reset()         { *m = SubmitResponse{} }
+func (m *SubmitResponse) String() string { return proto.CompactTextString(m) }
+func (*SubmitResponse) ProtoMessage()    {}
+
+func (m *SubmitResponse) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+type GetRequest struct {
+	Id string `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+}
+
+func (m *GetRequest) Reset()         { *m = GetRequest{} }
+func (m *GetRequest) String() string { return proto.CompactTextString(m) }
+func (*GetRequest) ProtoMessage()    {}
+
+func (m *GetRequest) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+type CancelRequest struct {
+	Id string `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+}
+
+func (m *CancelRequest) Reset()         { *m = CancelRequest{} }
+func (m *CancelRequest) String() string { return proto.CompactTextString(m) }
+func (*CancelRequest) ProtoMessage()    {}
+
+func (m *CancelRequest) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+type CancelResponse struct {
+	Canceled bool `protobuf:"varint,1,opt,name=canceled" json:"canceled,omitempty"`
+}
+
+func (m *CancelResponse) Reset()         { *m = CancelResponse{} }
+func (m *CancelResponse) String() string { return proto.CompactTextString(m) }
+func (*CancelResponse) ProtoMessage()    {}
+
+func (m *CancelResponse) GetCanceled() bool {
+	if m != nil {
+		return m.Canceled
+	}
+	return false
+}
+
+type StreamLogsRequest struct {
+	Id     string `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	Follow bool   `protobuf:"varint,2,opt,name=follow" json:"follow,omitempty"`
+}
+
+func (m *StreamLogsRequest) Reset()         { *m = StreamLogsRequest{} }
+func (m *StreamLogsRequest) String() string { return proto.CompactTextString(m) }
+func (*StreamLogsRequest) ProtoMessage()    {}
+
+func (m *StreamLogsRequest) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *StreamLogsRequest) GetFollow() bool {
+	if m != nil {
+		return m.Follow
+	}
+	return false
+}
+
+type JobStatus struct {
+	Id             string   `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	Args           []string `protobuf:"bytes,2,rep,name=args" json:"args,omitempty"`
+	Status         string   `protobuf:"bytes,3,opt,name=status" json:"status,omitempty"`
+	Error          string   `protobuf:"bytes,4,opt,name=error" json:"error,omitempty"`
+	CreatedAtUnix  int64    `protobuf:"varint,5,opt,name=created_at_unix,json=createdAtUnix" json:"created_at_unix,omitempty"`
+	StartedAtUnix  int64    `protobuf:"varint,6,opt,name=started_at_unix,json=startedAtUnix" json:"started_at_unix,omitempty"`
+	FinishedAtUnix int64    `protobuf:"varint,7,opt,name=finished_at_unix,json=finishedAtUnix" json:"finished_at_unix,omitempty"`
+}
+
+func (m *JobStatus) Reset()         { *m = JobStatus{} }
+func (m *JobStatus) String() string { return proto.CompactTextString(m) }
+func (*JobStatus) ProtoMessage()    {}
+
+type LogEntry struct {
+	Line  string `protobuf:"bytes,1,opt,name=line" json:"line,omitempty"`
+	Level string `protobuf:"bytes,2,opt,name=level" json:"level,omitempty"`
+	Msg   string `protobuf:"bytes,3,opt,name=msg" json:"msg,omitempty"`
+}
+
+func (m *LogEntry) Reset()         { *m = LogEntry{} }
+func (m *LogEntry) String() string { return proto.CompactTextString(m) }
+func (*LogEntry) ProtoMessage()    {}
+
+func (m *LogEntry) GetLine() string {
+	if m != nil {
+		return m.Line
+	}
+	return ""
+}
+
+func (m *LogEntry) GetLevel() string {
+	if m != nil {
+		return m.Level
+	}
+	return ""
+}
+
+func (m *LogEntry) GetMsg() string {
+	if m != nil {
+		return m.Msg
+	}
+	return ""
+}
+
+func init() {
+	proto.RegisterType((*SubmitRequest)(nil), "build.SubmitRequest")
+	proto.RegisterType((*SubmitResponse)(nil), "build.SubmitResponse")
+	proto.RegisterType((*GetRequest)(nil), "build.GetRequest")
+	proto.RegisterType((*CancelRequest)(nil), "build.CancelRequest")
+	proto.RegisterType((*CancelResponse)(nil), "build.CancelResponse")
+	proto.RegisterType((*StreamLogsRequest)(nil), "build.StreamLogsRequest")
+	proto.RegisterType((*JobStatus)(nil), "build.JobStatus")
+	proto.RegisterType((*LogEntry)(nil), "build.LogEntry")
+}
+
+// Client API for BuildService service
+
+type BuildServiceClient interface {
+	Submit(ctx context.Context, in *SubmitRequest, opts ...grpc.CallOption) (*SubmitResponse, error)
+	Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*JobStatus, error)
+	Cancel(ctx context.Context, in *CancelRequest, opts ...grpc.CallOption) (*CancelResponse, error)
+	StreamLogs(ctx context.Context, in *StreamLogsRequest, opts ...grpc.CallOption) (BuildService_StreamLogsClient, error)
+}
+
+type buildServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+// NewBuildServiceClient creates a client stub for BuildService backed by
+// cc, which may be a *grpc.ClientConn or anything else satisfying
+// grpc.ClientConnInterface.
+func NewBuildServiceClient(cc grpc.ClientConnInterface) BuildServiceClient {
+	return &buildServiceClient{cc}
+}
+
+func (c *buildServiceClient) Submit(ctx context.Context, in *SubmitRequest, opts ...grpc.CallOption) (*SubmitResponse, error) {
+	out := new(SubmitResponse)
+	if err := c.cc.Invoke(ctx, "/build.BuildService/Submit", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *buildServiceClient) Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*JobStatus, error) {
+	out := new(JobStatus)
+	if err := c.cc.Invoke(ctx, "/build.BuildService/Get", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *buildServiceClient) Cancel(ctx context.Context, in *CancelRequest, opts ...grpc.CallOption) (*CancelResponse, error) {
+	out := new(CancelResponse)
+	if err := c.cc.Invoke(ctx, "/build.BuildService/Cancel", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *buildServiceClient) StreamLogs(ctx context.Context, in *StreamLogsRequest, opts ...grpc.CallOption) (BuildService_StreamLogsClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_BuildService_serviceDesc.Streams[0], c.cc, "/build.BuildService/StreamLogs", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &buildServiceStreamLogsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// BuildService_StreamLogsClient is returned by the StreamLogs client stub.
+type BuildService_StreamLogsClient interface {
+	Recv() (*LogEntry, error)
+	grpc.ClientStream
+}
+
+type buildServiceStreamLogsClient struct {
+	grpc.ClientStream
+}
+
+func (x *buildServiceStreamLogsClient) Recv() (*LogEntry, error) {
+	m := new(LogEntry)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Server API for BuildService service
+
+type BuildServiceServer interface {
+	Submit(context.Context, *SubmitRequest) (*SubmitResponse, error)
+	Get(context.Context, *GetRequest) (*JobStatus, error)
+	Cancel(context.Context, *CancelRequest) (*CancelResponse, error)
+	StreamLogs(*StreamLogsRequest, BuildService_StreamLogsServer) error
+}
+
+// RegisterBuildServiceServer registers srv's implementation with s.
+func RegisterBuildServiceServer(s *grpc.Server, srv BuildServiceServer) {
+	s.RegisterService(&_BuildService_serviceDesc, srv)
+}
+
+func _BuildService_Submit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SubmitRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BuildServiceServer).Submit(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/build.BuildService/Submit"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BuildServiceServer).Submit(ctx, req.(*SubmitRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BuildService_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BuildServiceServer).Get(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/build.BuildService/Get"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BuildServiceServer).Get(ctx, req.(*GetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BuildService_Cancel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CancelRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BuildServiceServer).Cancel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/build.BuildService/Cancel"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BuildServiceServer).Cancel(ctx, req.(*CancelRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BuildService_StreamLogs_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamLogsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(BuildServiceServer).StreamLogs(m, &buildServiceStreamLogsServer{stream})
+}
+
+// BuildService_StreamLogsServer is passed to the StreamLogs server
+// implementation so it can push log entries as they're produced.
+type BuildService_StreamLogsServer interface {
+	Send(*LogEntry) error
+	grpc.ServerStream
+}
+
+type buildServiceStreamLogsServer struct {
+	grpc.ServerStream
+}
+
+func (x *buildServiceStreamLogsServer) Send(m *LogEntry) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+var _BuildService_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "build.BuildService",
+	HandlerType: (*BuildServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Submit", Handler: _BuildService_Submit_Handler},
+		{MethodName: "Get", Handler: _BuildService_Get_Handler},
+		{MethodName: "Cancel", Handler: _BuildService_Cancel_Handler},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamLogs",
+			Handler:       _BuildService_StreamLogs_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "proto/build.proto",
+}
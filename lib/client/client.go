@@ -0,0 +1,76 @@
+// Package client is a small Go wrapper around the BuildService gRPC API
+// exposed by `makisu listen`, for programs that want to submit and monitor
+// builds without reimplementing the JSON/HTTP protocol themselves.
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/uber/makisu/lib/buildpb"
+	"google.golang.org/grpc"
+)
+
+// Client talks to a single `makisu listen` instance's BuildService.
+type Client struct {
+	conn *grpc.ClientConn
+	rpc  buildpb.BuildServiceClient
+}
+
+// Dial connects to a makisu listen instance at addr, e.g. "localhost:2375"
+// or "unix:///makisu-socket/makisu.sock".
+func Dial(addr string, opts ...grpc.DialOption) (*Client, error) {
+	conn, err := grpc.Dial(addr, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("dial %s: %v", addr, err)
+	}
+	return &Client{conn: conn, rpc: buildpb.NewBuildServiceClient(conn)}, nil
+}
+
+// Close tears down the underlying gRPC connection.
+func (c *Client) Close() error { return c.conn.Close() }
+
+// Submit enqueues a new build with the given CLI args and returns its job
+// ID, e.g. Submit(ctx, "build", "-t", "myimage:latest", "/context").
+func (c *Client) Submit(ctx context.Context, args ...string) (string, error) {
+	resp, err := c.rpc.Submit(ctx, &buildpb.SubmitRequest{Args: args})
+	if err != nil {
+		return "", err
+	}
+	return resp.Id, nil
+}
+
+// Get returns the current status of the job with the given ID.
+func (c *Client) Get(ctx context.Context, id string) (*buildpb.JobStatus, error) {
+	return c.rpc.Get(ctx, &buildpb.GetRequest{Id: id})
+}
+
+// Cancel requests that the queued or running job with the given ID stop,
+// returning whether such a job was found and its cancellation requested.
+func (c *Client) Cancel(ctx context.Context, id string) (bool, error) {
+	resp, err := c.rpc.Cancel(ctx, &buildpb.CancelRequest{Id: id})
+	if err != nil {
+		return false, err
+	}
+	return resp.Canceled, nil
+}
+
+// StreamLogs calls fn with each log line produced by the given job, in
+// order. If follow is true, it blocks until the job reaches a terminal
+// status instead of returning once the existing log is exhausted.
+func (c *Client) StreamLogs(ctx context.Context, id string, follow bool, fn func(line string)) error {
+	stream, err := c.rpc.StreamLogs(ctx, &buildpb.StreamLogsRequest{Id: id, Follow: follow})
+	if err != nil {
+		return err
+	}
+	for {
+		entry, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		fn(entry.Line)
+	}
+}
@@ -0,0 +1,219 @@
+// Package contextunpack streams a tar or tar.gz build context uploaded over
+// HTTP into a local directory, the way the CLI expects to find it when the
+// context path is already on disk. It guards against two things a
+// network-supplied archive can do that a local directory can't: grow
+// without bound, and contain entries that escape the destination directory
+// via `..` segments or symlinks.
+package contextunpack
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// dockerignoreName is the name of the ignore file looked for at the root of
+// the archive, matching the semantics of a local build context.
+const dockerignoreName = ".dockerignore"
+
+// Unpack reads a tar or gzip-compressed tar stream from r and extracts it
+// under destDir, which must already exist. It refuses to read more than
+// maxSize bytes from r, refuses to write more than maxSize unpacked bytes
+// to disk, and refuses to write outside destDir. The unpacked-bytes check
+// matters even though the wire stream is already capped: a gzip-compressed
+// archive can expand far past the size actually read off the wire. Entries
+// matched by a root-level .dockerignore are skipped, mirroring how `makisu
+// build` treats a local context directory.
+func Unpack(r io.Reader, destDir string, maxSize int64) error {
+	limited := &io.LimitedReader{R: r, N: maxSize + 1}
+
+	// .dockerignore may appear anywhere in the stream, so the archive is
+	// buffered to a temp file first and read twice: once to find ignore
+	// patterns, once to extract.
+	tmp, err := ioutil.TempFile("", "makisu-context-*.tar")
+	if err != nil {
+		return fmt.Errorf("create context buffer: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if _, err := io.Copy(tmp, limited); err != nil {
+		return fmt.Errorf("buffer context upload: %v", err)
+	}
+	if limited.N <= 0 {
+		return fmt.Errorf("context upload exceeds max size of %d bytes", maxSize)
+	}
+
+	patterns, err := readDockerignore(tmp.Name())
+	if err != nil {
+		return fmt.Errorf("read .dockerignore: %v", err)
+	}
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("rewind context buffer: %v", err)
+	}
+	return extract(tmp, destDir, patterns, maxSize)
+}
+
+func readDockerignore(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tr, err := tarReader(f)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if filepath.Clean(hdr.Name) != dockerignoreName {
+			continue
+		}
+		body, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		return parseDockerignore(string(body)), nil
+	}
+}
+
+func parseDockerignore(body string) []string {
+	var patterns []string
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns
+}
+
+func ignored(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+		if strings.HasPrefix(name, strings.TrimSuffix(pattern, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func extract(r io.ReadSeeker, destDir string, patterns []string, maxSize int64) error {
+	tr, err := tarReader(r)
+	if err != nil {
+		return err
+	}
+
+	var written int64
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("read tar entry: %v", err)
+		}
+
+		name := filepath.Clean(hdr.Name)
+		if name == dockerignoreName || ignored(name, patterns) {
+			continue
+		}
+
+		target, err := safeJoin(destDir, name)
+		if err != nil {
+			return err
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, os.FileMode(hdr.Mode)|0700); err != nil {
+				return fmt.Errorf("mkdir %s: %v", target, err)
+			}
+		case tar.TypeSymlink:
+			// Symlinks are skipped rather than recreated: a symlink whose
+			// target falls outside destDir would let later writes escape it
+			// even though the entry name itself was safe.
+			continue
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return fmt.Errorf("mkdir %s: %v", filepath.Dir(target), err)
+			}
+			n, err := writeFile(target, tr, os.FileMode(hdr.Mode), maxSize-written)
+			if err != nil {
+				return err
+			}
+			written += n
+		}
+	}
+}
+
+// safeJoin joins name onto destDir and rejects the result if it would fall
+// outside destDir, which a `../` segment in a maliciously crafted archive
+// could otherwise achieve.
+func safeJoin(destDir, name string) (string, error) {
+	target := filepath.Join(destDir, name)
+	if target != destDir && !strings.HasPrefix(target, destDir+string(os.PathSeparator)) {
+		return "", fmt.Errorf("tar entry %q escapes destination directory", name)
+	}
+	return target, nil
+}
+
+// writeFile copies r to target, refusing to write more than remaining
+// bytes of the archive's unpacked-size budget, and returns the number of
+// bytes actually written so the caller can track the running total across
+// the whole archive.
+func writeFile(target string, r io.Reader, mode os.FileMode, remaining int64) (int64, error) {
+	f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return 0, fmt.Errorf("create %s: %v", target, err)
+	}
+	defer f.Close()
+
+	limited := &io.LimitedReader{R: r, N: remaining + 1}
+	n, err := io.Copy(f, limited)
+	if err != nil {
+		return n, fmt.Errorf("write %s: %v", target, err)
+	}
+	if limited.N <= 0 {
+		return n, fmt.Errorf("unpacked context exceeds remaining size budget of %d bytes", remaining)
+	}
+	return n, nil
+}
+
+// tarReader returns a *tar.Reader over r, transparently handling a gzip
+// envelope.
+func tarReader(r io.ReadSeeker) (*tar.Reader, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	magic := make([]byte, 2)
+	if _, err := io.ReadFull(r, magic); err != nil && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	if magic[0] == 0x1f && magic[1] == 0x8b {
+		gzr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("open gzip stream: %v", err)
+		}
+		return tar.NewReader(gzr), nil
+	}
+	return tar.NewReader(r), nil
+}
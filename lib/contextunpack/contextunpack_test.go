@@ -0,0 +1,165 @@
+package contextunpack
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSafeJoin(t *testing.T) {
+	destDir := "/unpack/dest"
+	tests := []struct {
+		name    string
+		entry   string
+		wantErr bool
+	}{
+		{name: "plain file", entry: "foo.txt"},
+		{name: "nested file", entry: "a/b/c.txt"},
+		{name: "escapes via dotdot", entry: "../../etc/passwd", wantErr: true},
+		{name: "escapes via leading dotdot segment", entry: "a/../../b", wantErr: true},
+		{name: "absolute path collapses inside dest", entry: "/unpack/dest/foo.txt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target, err := safeJoin(destDir, tt.entry)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("safeJoin(%q) = %q, want error", tt.entry, target)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("safeJoin(%q) returned unexpected error: %v", tt.entry, err)
+			}
+			if target != destDir && filepath.Dir(target) != destDir && !isUnder(destDir, target) {
+				t.Fatalf("safeJoin(%q) = %q, want path under %q", tt.entry, target, destDir)
+			}
+		})
+	}
+}
+
+func isUnder(destDir, target string) bool {
+	rel, err := filepath.Rel(destDir, target)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && !filepath.IsAbs(rel)
+}
+
+func TestExtractSkipsSymlinks(t *testing.T) {
+	destDir := t.TempDir()
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	writeTarHeader(t, tw, &tar.Header{
+		Name:     "escape",
+		Typeflag: tar.TypeSymlink,
+		Linkname: "/etc",
+		Mode:     0777,
+	}, nil)
+	writeTarHeader(t, tw, &tar.Header{
+		Name:     "real.txt",
+		Typeflag: tar.TypeReg,
+		Mode:     0644,
+		Size:     5,
+	}, []byte("hello"))
+	if err := tw.Close(); err != nil {
+		t.Fatalf("close tar writer: %v", err)
+	}
+
+	if err := extract(bytes.NewReader(buf.Bytes()), destDir, nil, 1<<20); err != nil {
+		t.Fatalf("extract() returned error: %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(destDir, "escape")); !os.IsNotExist(err) {
+		t.Fatalf("symlink entry was extracted, want it skipped (err=%v)", err)
+	}
+	if body, err := ioutil.ReadFile(filepath.Join(destDir, "real.txt")); err != nil || string(body) != "hello" {
+		t.Fatalf("real.txt = %q, %v, want %q, nil", body, err, "hello")
+	}
+}
+
+func TestExtractRejectsPathTraversal(t *testing.T) {
+	destDir := t.TempDir()
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	writeTarHeader(t, tw, &tar.Header{
+		Name:     "../../outside.txt",
+		Typeflag: tar.TypeReg,
+		Mode:     0644,
+		Size:     4,
+	}, []byte("evil"))
+	if err := tw.Close(); err != nil {
+		t.Fatalf("close tar writer: %v", err)
+	}
+
+	if err := extract(bytes.NewReader(buf.Bytes()), destDir, nil, 1<<20); err == nil {
+		t.Fatal("extract() succeeded on an entry escaping destDir, want error")
+	}
+}
+
+func TestWriteFileEnforcesBudget(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "out.bin")
+	body := bytes.Repeat([]byte("x"), 100)
+
+	if _, err := writeFile(target, bytes.NewReader(body), 0644, 50); err == nil {
+		t.Fatal("writeFile() succeeded past its remaining-bytes budget, want error")
+	}
+
+	n, err := writeFile(target, bytes.NewReader(body), 0644, 200)
+	if err != nil {
+		t.Fatalf("writeFile() within budget returned error: %v", err)
+	}
+	if n != int64(len(body)) {
+		t.Fatalf("writeFile() wrote %d bytes, want %d", n, len(body))
+	}
+}
+
+// TestUnpackGzipBombExceedsUnpackedBudget covers a gzip stream whose
+// compressed size is tiny but whose decompressed content blows past
+// maxSize, the case the wire-size check alone can't catch.
+func TestUnpackGzipBombExceedsUnpackedBudget(t *testing.T) {
+	destDir := t.TempDir()
+
+	var tarBuf bytes.Buffer
+	tw := tar.NewWriter(&tarBuf)
+	writeTarHeader(t, tw, &tar.Header{
+		Name:     "bomb.bin",
+		Typeflag: tar.TypeReg,
+		Mode:     0644,
+		Size:     1 << 20,
+	}, bytes.Repeat([]byte{0}, 1<<20))
+	if err := tw.Close(); err != nil {
+		t.Fatalf("close tar writer: %v", err)
+	}
+
+	var gzBuf bytes.Buffer
+	gzw := gzip.NewWriter(&gzBuf)
+	if _, err := gzw.Write(tarBuf.Bytes()); err != nil {
+		t.Fatalf("write gzip stream: %v", err)
+	}
+	if err := gzw.Close(); err != nil {
+		t.Fatalf("close gzip writer: %v", err)
+	}
+
+	err := Unpack(bytes.NewReader(gzBuf.Bytes()), destDir, 1<<16)
+	if err == nil {
+		t.Fatal("Unpack() succeeded on an archive exceeding the unpacked-size budget, want error")
+	}
+}
+
+func writeTarHeader(t *testing.T, tw *tar.Writer, hdr *tar.Header, body []byte) {
+	t.Helper()
+	if err := tw.WriteHeader(hdr); err != nil {
+		t.Fatalf("write tar header %s: %v", hdr.Name, err)
+	}
+	if len(body) == 0 {
+		return
+	}
+	if _, err := tw.Write(body); err != nil {
+		t.Fatalf("write tar body %s: %v", hdr.Name, err)
+	}
+}
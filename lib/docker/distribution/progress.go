@@ -0,0 +1,58 @@
+// Package distribution implements the registry client makisu's build
+// pipeline pushes a finished image through (see Client.Push). This file
+// adds an optional progress/digest hook pair that Push calls as it
+// uploads layers and pushes the manifest, so a caller driving a build
+// interactively (currently `makisu listen`'s /build/ws) can surface that
+// progress and the final digest without Push itself knowing anything
+// about WebSockets or gRPC.
+package distribution
+
+import "sync"
+
+// ProgressFunc reports incremental progress pushing a single image layer.
+type ProgressFunc func(layer string, bytes, total int64)
+
+// DigestFunc reports the digest of an image once its manifest has been
+// pushed.
+type DigestFunc func(digest string)
+
+// hooksMu guards onProgress and onDigest, the callbacks for whichever build
+// is currently pushing. Only one build can have hooks registered at a
+// time, matching the single-flight stderr capture in cli/listen.go.
+var (
+	hooksMu    sync.Mutex
+	onProgress ProgressFunc
+	onDigest   DigestFunc
+)
+
+// SetHooks registers the progress and digest callbacks for the build
+// currently in flight. Pass nil for either to clear it once the build
+// finishes.
+func SetHooks(progress ProgressFunc, digest DigestFunc) {
+	hooksMu.Lock()
+	onProgress, onDigest = progress, digest
+	hooksMu.Unlock()
+}
+
+// ReportProgress is called by the push client as each layer is uploaded. It
+// is a no-op unless a caller has registered hooks via SetHooks.
+func ReportProgress(layer string, bytes, total int64) {
+	hooksMu.Lock()
+	fn := onProgress
+	hooksMu.Unlock()
+	if fn != nil {
+		fn(layer, bytes, total)
+	}
+}
+
+// ReportDigest is called by the push client once the manifest has been
+// pushed and its digest is known. It is a no-op unless a caller has
+// registered hooks via SetHooks.
+func ReportDigest(digest string) {
+	hooksMu.Lock()
+	fn := onDigest
+	hooksMu.Unlock()
+	if fn != nil {
+		fn(digest)
+	}
+}
@@ -0,0 +1,148 @@
+package distribution
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Layer is a single pushable image layer: its (already compressed) tar
+// content, the digest the manifest references it by, and its size so
+// upload progress can be reported as a fraction of the whole.
+type Layer struct {
+	Digest string
+	Size   int64
+	Blob   io.Reader
+}
+
+// Client pushes a built image to a single repository on a v2 Docker
+// registry (https://docs.docker.com/registry/spec/api/).
+type Client struct {
+	Registry string // e.g. "https://index.docker.io"
+	Repo     string // e.g. "myorg/myimage"
+	HTTP     *http.Client
+}
+
+// NewClient returns a Client targeting repo on registry. httpClient may be
+// nil, in which case http.DefaultClient is used.
+func NewClient(registry, repo string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{Registry: registry, Repo: repo, HTTP: httpClient}
+}
+
+// Push uploads every layer and then the manifest that references them
+// under tag, returning the pushed manifest's digest. It calls
+// ReportProgress as each layer uploads and ReportDigest once the manifest
+// push succeeds, so a build driven interactively (currently `makisu
+// listen`'s /build/ws) can surface both without this package knowing
+// anything about WebSockets or gRPC.
+func (c *Client) Push(tag string, manifest []byte, layers []Layer) (string, error) {
+	for _, layer := range layers {
+		if err := c.pushLayer(layer); err != nil {
+			return "", fmt.Errorf("push layer %s: %v", layer.Digest, err)
+		}
+	}
+
+	digest, err := c.pushManifest(tag, manifest)
+	if err != nil {
+		return "", fmt.Errorf("push manifest: %v", err)
+	}
+	ReportDigest(digest)
+	return digest, nil
+}
+
+// pushLayer starts a blob upload and PUTs layer's content to it in a
+// single monolithic chunk, reporting incremental progress via
+// ReportProgress as the body is read off layer.Blob.
+func (c *Client) pushLayer(layer Layer) error {
+	uploadURL, err := c.startUpload()
+	if err != nil {
+		return fmt.Errorf("start blob upload: %v", err)
+	}
+
+	var uploaded int64
+	counting := &countingReader{r: layer.Blob, onRead: func(n int64) {
+		uploaded = n
+		ReportProgress(layer.Digest, uploaded, layer.Size)
+	}}
+
+	req, err := http.NewRequest(http.MethodPut, uploadURL+"?digest="+layer.Digest, counting)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = layer.Size
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("registry returned %s", resp.Status)
+	}
+	return nil
+}
+
+// startUpload opens a new blob upload session and returns the URL to PUT
+// its content to.
+func (c *Client) startUpload() (string, error) {
+	url := fmt.Sprintf("%s/v2/%s/blobs/uploads/", c.Registry, c.Repo)
+	resp, err := c.HTTP.Post(url, "", nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return "", fmt.Errorf("registry returned %s", resp.Status)
+	}
+	return resp.Header.Get("Location"), nil
+}
+
+// pushManifest PUTs manifest under tag and returns its digest, preferring
+// the Docker-Content-Digest response header and falling back to hashing
+// manifest locally if the registry doesn't send one.
+func (c *Client) pushManifest(tag string, manifest []byte) (string, error) {
+	url := fmt.Sprintf("%s/v2/%s/manifests/%s", c.Registry, c.Repo, tag)
+	req, err := http.NewRequest(http.MethodPut, url, bytes.NewReader(manifest))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/vnd.docker.distribution.manifest.v2+json")
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return "", fmt.Errorf("registry returned %s", resp.Status)
+	}
+	if d := resp.Header.Get("Docker-Content-Digest"); d != "" {
+		return d, nil
+	}
+	sum := sha256.Sum256(manifest)
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+// countingReader wraps r, calling onRead with the cumulative number of
+// bytes read so far after every Read.
+type countingReader struct {
+	r      io.Reader
+	n      int64
+	onRead func(n int64)
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if n > 0 {
+		c.n += int64(n)
+		c.onRead(c.n)
+	}
+	return n, err
+}
@@ -0,0 +1,238 @@
+// Package jobstore implements a small disk-backed store for build jobs
+// submitted to `makisu listen`. Each job gets its own directory containing
+// the original request body, a combined stdout/stderr log file, and a
+// status JSON file that is rewritten as the job progresses. The store also
+// enforces a maximum number of retained jobs, evicting the least recently
+// completed ones first.
+package jobstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Status describes the lifecycle state of a build job.
+type Status string
+
+// Possible job statuses.
+const (
+	StatusQueued    Status = "queued"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+	StatusCanceled  Status = "canceled"
+)
+
+// Record is the persisted representation of a single job.
+type Record struct {
+	ID         string     `json:"id"`
+	Args       []string   `json:"args"`
+	Status     Status     `json:"status"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// Done returns true if the job has reached a terminal status.
+func (r *Record) Done() bool {
+	switch r.Status {
+	case StatusSucceeded, StatusFailed, StatusCanceled:
+		return true
+	default:
+		return false
+	}
+}
+
+const statusFile = "status.json"
+const argsFile = "args.json"
+const logFile = "log"
+
+// Store persists job records and their logs under baseDir, one subdirectory
+// per job ID.
+type Store struct {
+	baseDir string
+	maxJobs int
+
+	mu sync.Mutex
+}
+
+// New creates a Store rooted at baseDir, creating it if necessary. maxJobs
+// of 0 or less disables eviction.
+func New(baseDir string, maxJobs int) (*Store, error) {
+	if err := os.MkdirAll(baseDir, 0755); err != nil {
+		return nil, fmt.Errorf("create job store dir %s: %v", baseDir, err)
+	}
+	return &Store{baseDir: baseDir, maxJobs: maxJobs}, nil
+}
+
+// Dir returns the per-job directory for id.
+func (s *Store) Dir(id string) string { return filepath.Join(s.baseDir, id) }
+
+// LogPath returns the path to the job's combined log file.
+func (s *Store) LogPath(id string) string { return filepath.Join(s.Dir(id), logFile) }
+
+// Create initializes a new job directory, persists its args, and writes an
+// initial queued status record.
+func (s *Store) Create(id string, args []string) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dir := s.Dir(id)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("create job dir %s: %v", dir, err)
+	}
+	argsBody, err := json.Marshal(args)
+	if err != nil {
+		return nil, fmt.Errorf("marshal job args: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, argsFile), argsBody, 0644); err != nil {
+		return nil, fmt.Errorf("write job args: %v", err)
+	}
+	if f, err := os.Create(s.LogPath(id)); err != nil {
+		return nil, fmt.Errorf("create job log %s: %v", s.LogPath(id), err)
+	} else {
+		f.Close()
+	}
+
+	record := &Record{ID: id, Args: args, Status: StatusQueued, CreatedAt: time.Now()}
+	if err := s.save(record); err != nil {
+		return nil, err
+	}
+	if err := s.evictLocked(); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// Save persists r's current state to disk.
+func (s *Store) Save(r *Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.save(r)
+}
+
+// save writes r to a temp file in the job's directory and renames it over
+// status.json, so a concurrent Load never observes a partially written
+// file: a plain truncate-then-write can hand back a short read to a
+// request that races a Save mid-write, which os.Rename can't do since it
+// only ever repoints the directory entry at a file that was fully written
+// first.
+func (s *Store) save(r *Record) error {
+	body, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal job record %s: %v", r.ID, err)
+	}
+	dir := s.Dir(r.ID)
+	tmp, err := ioutil.TempFile(dir, statusFile+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("create job record temp file %s: %v", r.ID, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(body); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write job record %s: %v", r.ID, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write job record %s: %v", r.ID, err)
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, statusFile)); err != nil {
+		return fmt.Errorf("write job record %s: %v", r.ID, err)
+	}
+	return nil
+}
+
+// Load reads the current record for id from disk.
+func (s *Store) Load(id string) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load(id)
+}
+
+func (s *Store) load(id string) (*Record, error) {
+	body, err := ioutil.ReadFile(filepath.Join(s.Dir(id), statusFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("read job record %s: %v", id, err)
+	}
+	record := &Record{}
+	if err := json.Unmarshal(body, record); err != nil {
+		return nil, fmt.Errorf("unmarshal job record %s: %v", id, err)
+	}
+	return record, nil
+}
+
+// List returns every job record currently on disk, most recently created
+// first.
+func (s *Store) List() ([]*Record, error) {
+	entries, err := ioutil.ReadDir(s.baseDir)
+	if err != nil {
+		return nil, fmt.Errorf("list job store: %v", err)
+	}
+	records := make([]*Record, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		record, err := s.Load(entry.Name())
+		if err != nil || record == nil {
+			continue
+		}
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].CreatedAt.After(records[j].CreatedAt) })
+	return records, nil
+}
+
+// evictLocked removes the least recently completed jobs until at most
+// maxJobs remain. Jobs that are still queued or running are never evicted.
+// Callers must hold s.mu.
+func (s *Store) evictLocked() error {
+	if s.maxJobs <= 0 {
+		return nil
+	}
+	entries, err := ioutil.ReadDir(s.baseDir)
+	if err != nil {
+		return fmt.Errorf("list job store: %v", err)
+	}
+	if len(entries) <= s.maxJobs {
+		return nil
+	}
+
+	type completed struct {
+		id string
+		at time.Time
+	}
+	var done []completed
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		record, err := s.load(entry.Name())
+		if err != nil || record == nil || !record.Done() {
+			continue
+		}
+		at := record.CreatedAt
+		if record.FinishedAt != nil {
+			at = *record.FinishedAt
+		}
+		done = append(done, completed{id: record.ID, at: at})
+	}
+	sort.Slice(done, func(i, j int) bool { return done[i].at.Before(done[j].at) })
+
+	excess := len(entries) - s.maxJobs
+	for i := 0; i < excess && i < len(done); i++ {
+		if err := os.RemoveAll(s.Dir(done[i].id)); err != nil {
+			return fmt.Errorf("evict job %s: %v", done[i].id, err)
+		}
+	}
+	return nil
+}